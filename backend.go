@@ -1,8 +1,12 @@
 package lib
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/taubyte/go-sdk/database"
@@ -13,11 +17,15 @@ import (
 
 // ===== TYPES =====
 type Pixel struct {
-	X        int    `json:"x"`
-	Y        int    `json:"y"`
-	Color    string `json:"color"`
-	UserID   string `json:"userId"`
-	Username string `json:"username"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Color     string `json:"color"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	SourceId  string `json:"sourceId,omitempty"`
+	ServerSeq int64  `json:"serverSeq,omitempty"`
+	Lamport   int64  `json:"lamport,omitempty"`
 }
 
 type User struct {
@@ -33,6 +41,8 @@ type ChatMessage struct {
 	Username  string `json:"username"`
 	Message   string `json:"message"`
 	Timestamp int64  `json:"timestamp"`
+	SourceId  string `json:"sourceId,omitempty"`
+	Lamport   int64  `json:"lamport,omitempty"`
 }
 
 // ===== CONSTANTS =====
@@ -114,6 +124,137 @@ func isMessageProcessed(messageId string, timestamp int64) bool {
 	return false
 }
 
+// blankCanvas returns a fresh all-white canvas, the starting point for both
+// the live getCanvas reconstruction and historical getCanvasAt replays.
+func blankCanvas() [][]string {
+	canvas := make([][]string, CanvasHeight)
+	for y := 0; y < CanvasHeight; y++ {
+		canvas[y] = make([]string, CanvasWidth)
+		for x := 0; x < CanvasWidth; x++ {
+			canvas[y][x] = "#ffffff"
+		}
+	}
+	return canvas
+}
+
+// parsePixelKey parses a versioned pixel CRDT key of the form
+// /<room>/<x>:<y>/<ts>-<sourceId> into its components.
+func parsePixelKey(key, roomPrefix string) (x, y int, ts int64, sourceId string, ok bool) {
+	if len(key) <= len(roomPrefix) {
+		return 0, 0, 0, "", false
+	}
+
+	rest := key[len(roomPrefix):]
+	slash := strings.IndexByte(rest, '/')
+	if slash < 0 {
+		return 0, 0, 0, "", false
+	}
+
+	coordPart, versionPart := rest[:slash], rest[slash+1:]
+	if n, err := fmt.Sscanf(coordPart, "%d:%d", &x, &y); n != 2 || err != nil {
+		return 0, 0, 0, "", false
+	}
+
+	dash := strings.IndexByte(versionPart, '-')
+	if dash < 0 {
+		return 0, 0, 0, "", false
+	}
+
+	parsedTs, err := strconv.ParseInt(versionPart[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, 0, "", false
+	}
+
+	return x, y, parsedTs, versionPart[dash+1:], true
+}
+
+// lamportWins reports whether (lamport, sourceId, ts) strictly dominates
+// (otherLamport, otherSourceId, otherTs), the tie-break used to pick the
+// canonical write for a cell so that all nodes converge on the same value
+// regardless of the order batches were actually processed in. ts only comes
+// into play when lamport and sourceId are both equal - e.g. two pixels in
+// the same batch (same tick, same sender) that repaint the same cell during
+// a drag-paint stroke - where it picks the one ingested later instead of
+// whichever happened to be listed first.
+func lamportWins(lamport int64, sourceId string, ts int64, otherLamport int64, otherSourceId string, otherTs int64) bool {
+	if lamport != otherLamport {
+		return lamport > otherLamport
+	}
+	if sourceId != otherSourceId {
+		return sourceId > otherSourceId
+	}
+	return ts > otherTs
+}
+
+// reconstructCanvasPixels replays the versioned pixel CRDT keys for room
+// with floor < ts <= ceil (ts is the real-world ingest time, used mainly to
+// scope the time window for history/replay, and as lamportWins' tertiary
+// tiebreaker). Within that window the canonical write per cell is the one
+// with the highest (lamport, sourceId, ts) - not the highest ts alone -
+// that's what gives convergence across nodes that see the same batch of
+// writes in different orders. Returns the full
+// winning Pixel per cell (including its serverSeq) so callers that need more
+// than just the color - e.g. delta queries - don't have to re-walk the
+// keyspace.
+func reconstructCanvasPixels(room string, floor, ceil int64) (map[[2]int]Pixel, error) {
+	db, err := database.New("/canvas")
+	if err != nil {
+		return nil, err
+	}
+
+	roomPrefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(roomPrefix)
+	if err != nil {
+		fmt.Printf("❌ [reconstructCanvasPixels] Error listing keys: %v\n", err)
+		return map[[2]int]Pixel{}, nil
+	}
+
+	pixels := make(map[[2]int]Pixel)
+
+	for _, key := range keys {
+		x, y, ts, _, ok := parsePixelKey(key, roomPrefix)
+		if !ok || ts <= floor || ts > ceil {
+			continue
+		}
+		if x < 0 || x >= CanvasWidth || y < 0 || y >= CanvasHeight {
+			continue
+		}
+
+		pixelData, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var pixel Pixel
+		if json.Unmarshal(pixelData, &pixel) != nil {
+			continue
+		}
+
+		cell := [2]int{x, y}
+		if existing, seen := pixels[cell]; seen && !lamportWins(pixel.Lamport, pixel.SourceId, ts, existing.Lamport, existing.SourceId, existing.Timestamp) {
+			continue
+		}
+
+		pixels[cell] = pixel
+	}
+
+	return pixels, nil
+}
+
+// reconstructCanvas is the color-only view of reconstructCanvasPixels, used
+// by the plain canvas reads that don't care about write metadata.
+func reconstructCanvas(room string, floor, ceil int64) (map[[2]int]string, error) {
+	pixels, err := reconstructCanvasPixels(room, floor, ceil)
+	if err != nil {
+		return nil, err
+	}
+
+	colors := make(map[[2]int]string, len(pixels))
+	for cell, pixel := range pixels {
+		colors[cell] = pixel.Color
+	}
+	return colors, nil
+}
+
 func setCORSHeaders(h http.Event) {
 	h.Headers().Set("Access-Control-Allow-Origin", "*")
 	h.Headers().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -200,59 +341,16 @@ func getCanvas(e event.Event) uint32 {
 		return fail(h, err, 400)
 	}
 
-	// Open canvas database
-	db, err := database.New("/canvas")
+	fmt.Printf("🔍 [getCanvas] Reconstructing full history for room %s\n", room)
+	colors, err := reconstructCanvas(room, -1, math.MaxInt64)
 	if err != nil {
 		return fail(h, err, 500)
 	}
+	fmt.Printf("✅ [getCanvas] Found %d painted cells for room %s\n", len(colors), room)
 
-	// Create empty canvas
-	canvas := make([][]string, CanvasHeight)
-	for y := 0; y < CanvasHeight; y++ {
-		canvas[y] = make([]string, CanvasWidth)
-		for x := 0; x < CanvasWidth; x++ {
-			canvas[y][x] = "#ffffff" // White pixels
-		}
-	}
-
-	// List all keys for this room using CRDT pattern
-	roomPrefix := fmt.Sprintf("/%s/", room)
-	fmt.Printf("🔍 [getCanvas] Listing keys with prefix: %s\n", roomPrefix)
-	keys, err := db.List(roomPrefix)
-	if err != nil {
-		fmt.Printf("❌ [getCanvas] Error listing keys: %v\n", err)
-	} else {
-		fmt.Printf("✅ [getCanvas] Found %d keys for room %s\n", len(keys), room)
-		// Process each pixel key
-		for _, key := range keys {
-			fmt.Printf("🎨 [getCanvas] Processing key: %s\n", key)
-			// Parse key to get x,y coordinates
-			// Key format: /<room>/<x>:<y>
-			if len(key) > len(roomPrefix) {
-				coordPart := key[len(roomPrefix):]
-				var x, y int
-				if n, err := fmt.Sscanf(coordPart, "%d:%d", &x, &y); n == 2 && err == nil {
-					fmt.Printf("📍 [getCanvas] Parsed coordinates: x=%d, y=%d\n", x, y)
-					if x >= 0 && x < CanvasWidth && y >= 0 && y < CanvasHeight {
-						// Get pixel data
-						pixelData, err := db.Get(key)
-						if err == nil {
-							var pixel Pixel
-							if json.Unmarshal(pixelData, &pixel) == nil {
-								canvas[y][x] = pixel.Color
-								fmt.Printf("✅ [getCanvas] Set pixel at (%d,%d) to color %s\n", x, y, pixel.Color)
-							}
-						} else {
-							fmt.Printf("❌ [getCanvas] Error getting pixel data for key %s: %v\n", key, err)
-						}
-					} else {
-						fmt.Printf("⚠️ [getCanvas] Coordinates out of bounds: x=%d, y=%d\n", x, y)
-					}
-				} else {
-					fmt.Printf("❌ [getCanvas] Failed to parse coordinates from: %s\n", coordPart)
-				}
-			}
-		}
+	canvas := blankCanvas()
+	for cell, color := range colors {
+		canvas[cell[1]][cell[0]] = color
 	}
 
 	// Return reconstructed canvas
@@ -398,40 +496,30 @@ func getMessages(e event.Event) uint32 {
 
 	fmt.Printf("✅ [getMessages] Found %d keys for room %s\n", len(keys), room)
 
-	// Collect all messages
+	// Collect all messages. Key format is /<room>/<lamport>-<sourceId>; the
+	// message's own fields (not the key) carry timestamp and ordering info.
 	var messages []ChatMessage
 	for _, key := range keys {
 		fmt.Printf("💬 [getMessages] Processing key: %s\n", key)
-		// Parse key to get timestamp
-		// Key format: /<room>/<timestamp>
-		if len(key) > len(roomPrefix) {
-			timestampPart := key[len(roomPrefix):]
-			var timestamp int64
-			if n, err := fmt.Sscanf(timestampPart, "%d", &timestamp); n == 1 && err == nil {
-				fmt.Printf("⏰ [getMessages] Parsed timestamp: %d\n", timestamp)
-				// Get message data
-				messageData, err := db.Get(key)
-				if err == nil {
-					var message ChatMessage
-					if json.Unmarshal(messageData, &message) == nil {
-						messages = append(messages, message)
-						fmt.Printf("✅ [getMessages] Added message: %s from %s\n", message.Message, message.Username)
-					} else {
-						fmt.Printf("❌ [getMessages] Failed to unmarshal message data for key %s\n", key)
-					}
-				} else {
-					fmt.Printf("❌ [getMessages] Error getting message data for key %s: %v\n", key, err)
-				}
-			} else {
-				fmt.Printf("❌ [getMessages] Failed to parse timestamp from: %s\n", timestampPart)
-			}
+		messageData, err := db.Get(key)
+		if err != nil {
+			fmt.Printf("❌ [getMessages] Error getting message data for key %s: %v\n", key, err)
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(messageData, &message) != nil {
+			fmt.Printf("❌ [getMessages] Failed to unmarshal message data for key %s\n", key)
+			continue
 		}
+		messages = append(messages, message)
+		fmt.Printf("✅ [getMessages] Added message: %s from %s\n", message.Message, message.Username)
 	}
 
-	// Sort messages by timestamp (oldest first)
+	// Sort by Lamport clock (oldest first) for a deterministic, causally
+	// consistent order across nodes - real-world timestamps can race.
 	for i := 0; i < len(messages); i++ {
 		for j := i + 1; j < len(messages); j++ {
-			if messages[i].Timestamp > messages[j].Timestamp {
+			if messages[i].Lamport > messages[j].Lamport {
 				messages[i], messages[j] = messages[j], messages[i]
 			}
 		}
@@ -471,10 +559,13 @@ func onPixelUpdate(e event.Event) uint32 {
 
 	var pixelBatch struct {
 		Pixels    []Pixel `json:"pixels"`
+		Format    string  `json:"format,omitempty"`  // "" / "json" (default) or "binary"
+		Encoded   string  `json:"encoded,omitempty"` // base64 packed payload when Format == "binary"
 		Room      string  `json:"room"`
 		Timestamp int64   `json:"timestamp"`
 		BatchId   string  `json:"batchId"`
 		SourceId  string  `json:"sourceId"`
+		Lamport   int64   `json:"lamport,omitempty"` // sender's Lamport clock at send time
 	}
 
 	err = json.Unmarshal(data, &pixelBatch)
@@ -487,8 +578,27 @@ func onPixelUpdate(e event.Event) uint32 {
 		return 0
 	}
 
-	// Use room from message
+	pixelList := pixelBatch.Pixels
 	room := pixelBatch.Room
+
+	if pixelBatch.Format == "binary" {
+		raw, err := base64.StdEncoding.DecodeString(pixelBatch.Encoded)
+		if err != nil {
+			fmt.Printf("❌ [onPixelUpdate] Failed to base64-decode binary envelope: %v\n", err)
+			return 1
+		}
+		binaryRoom, decoded, err := decodePixelsBinary(raw)
+		if err != nil {
+			fmt.Printf("❌ [onPixelUpdate] Failed to decode binary envelope: %v\n", err)
+			return 1
+		}
+		pixelList = decoded
+		if room == "" {
+			room = binaryRoom
+		}
+	}
+
+	// Use room from message
 	if room == "" {
 		room = "default"
 	}
@@ -499,17 +609,83 @@ func onPixelUpdate(e event.Event) uint32 {
 		return 1
 	}
 
+	sourceId := pixelBatch.SourceId
+	if sourceId == "" {
+		sourceId = "unknown"
+	}
+
+	userId := "unknown"
+	if len(pixelList) > 0 {
+		userId = pixelList[0].UserID
+	}
+
+	// Reject the whole batch if it exceeds the room's pixels/sec budget for
+	// this user. This backs up the in-memory processedBatchIds map, which any
+	// client can bypass by sending novel batch IDs.
+	cfg := roomRateLimitConfig(db, room)
+	allowed, err := checkPixelRateLimit(db, cfg, room, userId, len(pixelList))
+	if err != nil {
+		fmt.Printf("❌ [onPixelUpdate] Rate limit check failed: %v\n", err)
+		return 1
+	}
+	if !allowed {
+		fmt.Printf("🚫 [onPixelUpdate] Rate limit exceeded for user %s in room %s\n", userId, room)
+		broadcastRejection("pixelupdates", "rate_limited", room, userId)
+		return 0
+	}
+
+	// r/place-style per-user cooldown: reject the whole batch if it arrives
+	// before the user's next allowed write time, and notify only them.
+	if cooldownOK, retryAfterMs := checkCooldown(db, room, userId); !cooldownOK {
+		fmt.Printf("🚫 [onPixelUpdate] User %s in room %s is on cooldown for %dms\n", userId, room, retryAfterMs)
+		broadcastCooldownRejection(room, userId, retryAfterMs)
+		return 0
+	}
+	if err := armCooldown(db, room, userId); err != nil {
+		fmt.Printf("❌ [onPixelUpdate] Failed to arm cooldown for %s: %v\n", userId, err)
+	}
+
+	// Load any active region locks for this room once, up front, so each
+	// pixel in the batch can be checked against them cheaply.
+	locks := roomLocks(db, room)
+
+	// Advance this node's Lamport clock once per received message:
+	// local = max(local, incoming) + 1. Every pixel in the batch shares it,
+	// same as a single Lamport "event".
+	lamport, err := tickLamport(pixelBatch.Lamport)
+	if err != nil {
+		fmt.Printf("❌ [onPixelUpdate] Failed to advance Lamport clock: %v\n", err)
+		return 1
+	}
+
 	// Process each pixel in the batch using CRDT key pattern
-	fmt.Printf("🎨 [onPixelUpdate] Processing %d pixels for room %s\n", len(pixelBatch.Pixels), room)
+	fmt.Printf("🎨 [onPixelUpdate] Processing %d pixels for room %s (format=%q, lamport=%d)\n", len(pixelList), room, pixelBatch.Format, lamport)
 	validPixels := []Pixel{}
-	for i, pixel := range pixelBatch.Pixels {
+	for i, pixel := range pixelList {
 		fmt.Printf("📍 [onPixelUpdate] Pixel %d: x=%d, y=%d, color=%s\n", i, pixel.X, pixel.Y, pixel.Color)
 		if pixel.X >= 0 && pixel.X < CanvasWidth &&
 			pixel.Y >= 0 && pixel.Y < CanvasHeight {
 
-			// Use CRDT key pattern: /<room>/<x>:<y>
-			pixelKey := fmt.Sprintf("/%s/%d:%d", room, pixel.X, pixel.Y)
-			fmt.Printf("🔑 [onPixelUpdate] Using key: %s\n", pixelKey)
+			if lock := blockingLock(locks, pixel.X, pixel.Y, userId, time.Now().UnixMilli()); lock != nil {
+				fmt.Printf("🔒 [onPixelUpdate] Pixel (%d,%d) rejected: region locked by %s\n", pixel.X, pixel.Y, lock.OwnerUserID)
+				continue
+			}
+
+			// Versioned CRDT key: /<room>/<x>:<y>/<ts>-<sourceId>, so every
+			// write is kept instead of overwriting the cell in place.
+			// (Lamport, SourceId, ts) is what decides the canonical value
+			// for the cell - see lamportWins.
+			pixel.Timestamp = time.Now().UnixNano()
+			pixel.SourceId = sourceId
+			pixel.Lamport = lamport
+			seq, err := nextRoomSeq(db, room)
+			if err != nil {
+				fmt.Printf("❌ [onPixelUpdate] Failed to advance room sequence: %v\n", err)
+				continue
+			}
+			pixel.ServerSeq = seq
+			pixelKey := fmt.Sprintf("/%s/%d:%d/%d-%s", room, pixel.X, pixel.Y, pixel.Timestamp, sourceId)
+			fmt.Printf("🔑 [onPixelUpdate] Using key: %s (seq=%d)\n", pixelKey, seq)
 
 			// Store pixel data as JSON
 			pixelData, err := json.Marshal(pixel)
@@ -531,7 +707,7 @@ func onPixelUpdate(e event.Event) uint32 {
 			fmt.Printf("⚠️ [onPixelUpdate] Pixel out of bounds: x=%d, y=%d\n", pixel.X, pixel.Y)
 		}
 	}
-	fmt.Printf("✅ [onPixelUpdate] Processed %d valid pixels out of %d total\n", len(validPixels), len(pixelBatch.Pixels))
+	fmt.Printf("✅ [onPixelUpdate] Processed %d valid pixels out of %d total\n", len(validPixels), len(pixelList))
 
 	return 0
 }
@@ -550,13 +726,15 @@ func onChatMessages(e event.Event) uint32 {
 	}
 
 	var message struct {
-		Message   string `json:"message"`
-		UserID    string `json:"userId"`
-		Username  string `json:"username"`
-		Room      string `json:"room"`
-		MessageID string `json:"messageId"`
-		Timestamp int64  `json:"timestamp"`
-		SourceId  string `json:"sourceId"`
+		Message         string `json:"message"`
+		UserID          string `json:"userId"`
+		Username        string `json:"username"`
+		Room            string `json:"room"`
+		MessageID       string `json:"messageId"`
+		Timestamp       int64  `json:"timestamp"`
+		SourceId        string `json:"sourceId"`
+		Lamport         int64  `json:"lamport,omitempty"`
+		TypingIndicator bool   `json:"typingIndicator,omitempty"`
 	}
 
 	err = json.Unmarshal(data, &message)
@@ -564,17 +742,44 @@ func onChatMessages(e event.Event) uint32 {
 		return 1
 	}
 
-	// Check for duplicate message processing (server-side deduplication)
-	if isMessageProcessed(message.MessageID, message.Timestamp) {
-		return 0
-	}
-
 	// Use room from message
 	room := message.Room
 	if room == "" {
 		room = "default"
 	}
 
+	// A typing indicator is not a chat message - just refresh the user's
+	// presence row and republish it on the presence channel so subscribers
+	// can show "X is typing", and skip persistence, dedup and rate limiting
+	// entirely.
+	if message.TypingIndicator {
+		// Merge onto the existing row instead of overwriting it outright -
+		// Color is only set by joinGame or a full onUserUpdate heartbeat, so
+		// a fresh PresenceHeartbeat here would wipe it back to "" until the
+		// user's next full heartbeat.
+		heartbeat, err := getHeartbeat(room, message.UserID)
+		if err != nil {
+			fmt.Printf("❌ [onChatMessage] Failed to load presence for %s: %v\n", message.UserID, err)
+		}
+		heartbeat.UserID = message.UserID
+		heartbeat.Username = message.Username
+		heartbeat.LastHeartbeat = time.Now().UnixMilli()
+		heartbeat.Typing = true
+		heartbeat.Offline = false
+
+		if err := putHeartbeat(room, heartbeat); err != nil {
+			fmt.Printf("❌ [onChatMessage] Failed to record typing indicator for %s: %v\n", message.UserID, err)
+			return 1
+		}
+		broadcastPresence(heartbeat)
+		return 0
+	}
+
+	// Check for duplicate message processing (server-side deduplication)
+	if isMessageProcessed(message.MessageID, message.Timestamp) {
+		return 0
+	}
+
 	// Update messages in database using CRDT key pattern
 	db, err := database.New("/chat")
 	if err != nil {
@@ -592,8 +797,40 @@ func onChatMessages(e event.Event) uint32 {
 		timestamp = time.Now().Unix()
 	}
 
-	// Use CRDT key pattern: /<room>/<timestamp>
-	chatKey := fmt.Sprintf("/%s/%d", room, timestamp)
+	sourceId := message.SourceId
+	if sourceId == "" {
+		sourceId = "unknown"
+	}
+
+	// Reject the message if it exceeds the room's messages/minute budget for
+	// this user.
+	canvasDb, err := database.New("/canvas")
+	if err != nil {
+		return 1
+	}
+	cfg := roomRateLimitConfig(canvasDb, room)
+	allowed, err := checkChatRateLimit(canvasDb, cfg, room, message.UserID)
+	if err != nil {
+		fmt.Printf("❌ [onChatMessage] Rate limit check failed: %v\n", err)
+		return 1
+	}
+	if !allowed {
+		fmt.Printf("🚫 [onChatMessage] Rate limit exceeded for user %s in room %s\n", message.UserID, room)
+		broadcastRejection("chatmessages", "rate_limited", room, message.UserID)
+		return 0
+	}
+
+	// Advance this node's Lamport clock the same way onPixelUpdate does, so
+	// simultaneous messages from different users don't collide on
+	// time.Now().Unix() and every node converges on the same ordering.
+	lamport, err := tickLamport(message.Lamport)
+	if err != nil {
+		fmt.Printf("❌ [onChatMessage] Failed to advance Lamport clock: %v\n", err)
+		return 1
+	}
+
+	// CRDT key pattern: /<room>/<lamport>-<sourceId>
+	chatKey := fmt.Sprintf("/%s/%d-%s", room, lamport, sourceId)
 	fmt.Printf("💬 [onChatMessage] Processing message for room %s\n", room)
 	fmt.Printf("🔑 [onChatMessage] Using key: %s\n", chatKey)
 
@@ -603,6 +840,8 @@ func onChatMessages(e event.Event) uint32 {
 		Username:  message.Username,
 		Message:   message.Message,
 		Timestamp: timestamp,
+		SourceId:  sourceId,
+		Lamport:   lamport,
 	}
 
 	fmt.Printf("📝 [onChatMessage] Message: %s from %s (ID: %s)\n", message.Message, message.Username, messageId)
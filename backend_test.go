@@ -0,0 +1,34 @@
+package lib
+
+import "testing"
+
+func TestLamportWinsHigherLamport(t *testing.T) {
+	if !lamportWins(2, "a", 100, 1, "z", 200) {
+		t.Error("a higher lamport should win regardless of sourceId/ts")
+	}
+}
+
+func TestLamportWinsSameLamportHigherSourceId(t *testing.T) {
+	if !lamportWins(5, "b", 100, 5, "a", 200) {
+		t.Error("equal lamport should fall back to the higher sourceId")
+	}
+}
+
+func TestLamportWinsSameBatchDuplicateCellUsesTsTiebreak(t *testing.T) {
+	// Two writes to the same cell within one batch share both lamport and
+	// sourceId (ordinary during a drag-paint stroke that revisits a pixel);
+	// the later ts must win so the canvas shows the final color painted,
+	// not whichever write happened to be mapped/listed first.
+	if lamportWins(5, "a", 100, 5, "a", 200) {
+		t.Error("an earlier ts should not win over a later one at equal lamport/sourceId")
+	}
+	if !lamportWins(5, "a", 200, 5, "a", 100) {
+		t.Error("a later ts should win at equal lamport/sourceId")
+	}
+}
+
+func TestLamportWinsExactTie(t *testing.T) {
+	if lamportWins(5, "a", 100, 5, "a", 100) {
+		t.Error("an exact tie should not claim victory over itself")
+	}
+}
@@ -0,0 +1,361 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+// ===== BINARY PIXEL WIRE FORMAT =====
+//
+// [0]       magic byte (binaryMagic)
+// [1]       encoding byte (binaryEncodingRaw | binaryEncodingRLE)
+// [2]       room name length (uint8)
+// [3:3+n]   room name bytes
+// next      varint pixel count
+// then, per encoding:
+//   raw: count * { x:uint16, y:uint16, color:uint24 } big-endian
+//   rle: repeated { color:uint24, runLen:varint, runLen * {x:uint16, y:uint16} }
+//        runs group consecutive same-colored pixels, which is common for
+//        bucket fills and cuts most of the JSON envelope's per-pixel overhead.
+
+const (
+	binaryMagic        byte = 0xB1
+	binaryEncodingRaw  byte = 0
+	binaryEncodingRLE  byte = 1
+	rleMinRun               = 8 // only worth the run header once this many identical pixels are in a row
+)
+
+func parseHexColor(color string) (uint32, error) {
+	if len(color) != 7 || color[0] != '#' {
+		return 0, fmt.Errorf("invalid color %q", color)
+	}
+	v, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(v), nil
+}
+
+func formatHexColor(rgb uint32) string {
+	return fmt.Sprintf("#%06x", rgb&0xffffff)
+}
+
+// sortPixelsByPosition orders pixels in row-major (y, then x) order, so
+// same-colored runs from an actual spatial fill are contiguous for
+// shouldRLE/writeRLEPixels instead of whatever order the caller's map
+// iteration happened to produce.
+func sortPixelsByPosition(pixels []Pixel) {
+	sort.Slice(pixels, func(i, j int) bool {
+		if pixels[i].Y != pixels[j].Y {
+			return pixels[i].Y < pixels[j].Y
+		}
+		return pixels[i].X < pixels[j].X
+	})
+}
+
+// shouldRLE decides whether pixels contains a run of identical consecutive
+// colors long enough to make RLE worth it (e.g. a flood fill).
+func shouldRLE(pixels []Pixel) bool {
+	run := 1
+	for i := 1; i < len(pixels); i++ {
+		if pixels[i].Color == pixels[i-1].Color {
+			run++
+			if run >= rleMinRun {
+				return true
+			}
+		} else {
+			run = 1
+		}
+	}
+	return false
+}
+
+// encodePixelsBinary packs room and pixels into the compact wire format
+// described above, negotiated via the envelope's "format" field.
+func encodePixelsBinary(room string, pixels []Pixel) ([]byte, error) {
+	if len(room) > 255 {
+		return nil, fmt.Errorf("room name too long for binary envelope: %d bytes", len(room))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(binaryMagic)
+
+	encoding := binaryEncodingRaw
+	if shouldRLE(pixels) {
+		encoding = binaryEncodingRLE
+	}
+	buf.WriteByte(encoding)
+
+	buf.WriteByte(byte(len(room)))
+	buf.WriteString(room)
+
+	countBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(countBuf, uint64(len(pixels)))
+	buf.Write(countBuf[:n])
+
+	var err error
+	if encoding == binaryEncodingRLE {
+		err = writeRLEPixels(&buf, pixels)
+	} else {
+		err = writeRawPixels(&buf, pixels)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeRawPixels(buf *bytes.Buffer, pixels []Pixel) error {
+	for _, p := range pixels {
+		rgb, err := parseHexColor(p.Color)
+		if err != nil {
+			return err
+		}
+		var entry [7]byte
+		binary.BigEndian.PutUint16(entry[0:2], uint16(p.X))
+		binary.BigEndian.PutUint16(entry[2:4], uint16(p.Y))
+		entry[4] = byte(rgb >> 16)
+		entry[5] = byte(rgb >> 8)
+		entry[6] = byte(rgb)
+		buf.Write(entry[:])
+	}
+	return nil
+}
+
+func writeRLEPixels(buf *bytes.Buffer, pixels []Pixel) error {
+	for i := 0; i < len(pixels); {
+		j := i + 1
+		for j < len(pixels) && pixels[j].Color == pixels[i].Color {
+			j++
+		}
+		run := pixels[i:j]
+
+		rgb, err := parseHexColor(run[0].Color)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(byte(rgb >> 16))
+		buf.WriteByte(byte(rgb >> 8))
+		buf.WriteByte(byte(rgb))
+
+		countBuf := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(countBuf, uint64(len(run)))
+		buf.Write(countBuf[:n])
+
+		for _, p := range run {
+			var coord [4]byte
+			binary.BigEndian.PutUint16(coord[0:2], uint16(p.X))
+			binary.BigEndian.PutUint16(coord[2:4], uint16(p.Y))
+			buf.Write(coord[:])
+		}
+
+		i = j
+	}
+	return nil
+}
+
+// decodePixelsBinary unpacks a binary envelope produced by encodePixelsBinary.
+func decodePixelsBinary(data []byte) (string, []Pixel, error) {
+	if len(data) < 2 || data[0] != binaryMagic {
+		return "", nil, fmt.Errorf("not a recognized binary pixel envelope")
+	}
+	encoding := data[1]
+	pos := 2
+
+	if pos >= len(data) {
+		return "", nil, fmt.Errorf("truncated binary envelope: missing room length")
+	}
+	roomLen := int(data[pos])
+	pos++
+	if pos+roomLen > len(data) {
+		return "", nil, fmt.Errorf("truncated binary envelope: missing room name")
+	}
+	room := string(data[pos : pos+roomLen])
+	pos += roomLen
+
+	count, n := binary.Uvarint(data[pos:])
+	if n <= 0 {
+		return "", nil, fmt.Errorf("truncated binary envelope: missing pixel count")
+	}
+	pos += n
+
+	pixels := make([]Pixel, 0, count)
+
+	switch encoding {
+	case binaryEncodingRLE:
+		for uint64(len(pixels)) < count {
+			if pos+3 > len(data) {
+				return "", nil, fmt.Errorf("truncated RLE run color")
+			}
+			rgb := uint32(data[pos])<<16 | uint32(data[pos+1])<<8 | uint32(data[pos+2])
+			pos += 3
+			color := formatHexColor(rgb)
+
+			runLen, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return "", nil, fmt.Errorf("truncated RLE run length")
+			}
+			pos += n
+
+			for i := uint64(0); i < runLen; i++ {
+				if pos+4 > len(data) {
+					return "", nil, fmt.Errorf("truncated RLE coordinate")
+				}
+				x := binary.BigEndian.Uint16(data[pos : pos+2])
+				y := binary.BigEndian.Uint16(data[pos+2 : pos+4])
+				pos += 4
+				pixels = append(pixels, Pixel{X: int(x), Y: int(y), Color: color})
+			}
+		}
+	default:
+		for uint64(len(pixels)) < count {
+			if pos+7 > len(data) {
+				return "", nil, fmt.Errorf("truncated raw pixel entry")
+			}
+			x := binary.BigEndian.Uint16(data[pos : pos+2])
+			y := binary.BigEndian.Uint16(data[pos+2 : pos+4])
+			rgb := uint32(data[pos+4])<<16 | uint32(data[pos+5])<<8 | uint32(data[pos+6])
+			pos += 7
+			pixels = append(pixels, Pixel{X: int(x), Y: int(y), Color: formatHexColor(rgb)})
+		}
+	}
+
+	return room, pixels, nil
+}
+
+// ===== SERVER SEQUENCE COUNTER =====
+
+// nextRoomSeq advances and returns room's monotonically increasing write
+// counter, stored at /seq/<room> (outside the /<room>/ pixel key namespace so
+// it's never picked up by a room-prefixed List call).
+func nextRoomSeq(db *database.Database, room string) (int64, error) {
+	seqKey := fmt.Sprintf("/seq/%s", room)
+
+	var seq int64
+	if raw, err := db.Get(seqKey); err == nil {
+		seq, _ = strconv.ParseInt(string(raw), 10, 64)
+	}
+	seq++
+
+	if err := db.Put(seqKey, []byte(strconv.FormatInt(seq, 10))); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+func roomSeq(db *database.Database, room string) int64 {
+	raw, err := db.Get(fmt.Sprintf("/seq/%s", room))
+	if err != nil {
+		return 0
+	}
+	seq, _ := strconv.ParseInt(string(raw), 10, 64)
+	return seq
+}
+
+// ===== HTTP HANDLERS =====
+
+//export getCanvasBinary
+func getCanvasBinary(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	pixelsByCell, err := reconstructCanvasPixels(room, -1, math.MaxInt64)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	pixels := make([]Pixel, 0, len(pixelsByCell))
+	for _, pixel := range pixelsByCell {
+		pixels = append(pixels, pixel)
+	}
+	sortPixelsByPosition(pixels)
+
+	encoded, err := encodePixelsBinary(room, pixels)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("📦 [getCanvasBinary] Packed %d pixels for room %s into %d bytes\n", len(pixels), room, len(encoded))
+
+	h.Headers().Set("Content-Type", "application/octet-stream")
+	h.Write(encoded)
+	h.Return(200)
+	return 0
+}
+
+//export getCanvasDelta
+func getCanvasDelta(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	sinceStr, err := h.Query().Get("since")
+	if err != nil {
+		sinceStr = "0"
+	}
+	since, err := strconv.ParseInt(sinceStr, 10, 64)
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	pixelsByCell, err := reconstructCanvasPixels(room, -1, math.MaxInt64)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	changed := []Pixel{}
+	for _, pixel := range pixelsByCell {
+		if pixel.ServerSeq > since {
+			changed = append(changed, pixel)
+		}
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	response := struct {
+		Seq    int64   `json:"seq"`
+		Pixels []Pixel `json:"pixels"`
+	}{
+		Seq:    roomSeq(db, room),
+		Pixels: changed,
+	}
+
+	fmt.Printf("🔺 [getCanvasDelta] Room %s: %d pixels changed since seq %d (now at %d)\n", room, len(changed), since, response.Seq)
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(jsonData)
+	h.Return(200)
+	return 0
+}
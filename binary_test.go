@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodePixelsBinaryRoundTrip(t *testing.T) {
+	pixels := []Pixel{
+		{X: 3, Y: 1, Color: "#ff0000"},
+		{X: 4, Y: 1, Color: "#ff0000"},
+		{X: 0, Y: 0, Color: "#00ff00"},
+	}
+
+	encoded, err := encodePixelsBinary("room1", pixels)
+	if err != nil {
+		t.Fatalf("encodePixelsBinary returned error: %v", err)
+	}
+
+	room, decoded, err := decodePixelsBinary(encoded)
+	if err != nil {
+		t.Fatalf("decodePixelsBinary returned error: %v", err)
+	}
+	if room != "room1" {
+		t.Errorf("room = %q, want %q", room, "room1")
+	}
+	if !reflect.DeepEqual(decoded, pixels) {
+		t.Errorf("decoded pixels = %+v, want %+v", decoded, pixels)
+	}
+}
+
+func TestEncodeDecodePixelsBinaryRLERoundTrip(t *testing.T) {
+	pixels := make([]Pixel, 0, rleMinRun+2)
+	for x := 0; x < rleMinRun+2; x++ {
+		pixels = append(pixels, Pixel{X: x, Y: 0, Color: "#123456"})
+	}
+
+	encoded, err := encodePixelsBinary("room1", pixels)
+	if err != nil {
+		t.Fatalf("encodePixelsBinary returned error: %v", err)
+	}
+	if encoded[1] != binaryEncodingRLE {
+		t.Fatalf("expected RLE encoding for a long run, got encoding byte %d", encoded[1])
+	}
+
+	_, decoded, err := decodePixelsBinary(encoded)
+	if err != nil {
+		t.Fatalf("decodePixelsBinary returned error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, pixels) {
+		t.Errorf("decoded pixels = %+v, want %+v", decoded, pixels)
+	}
+}
+
+func TestSortPixelsByPositionMakesRunsContiguous(t *testing.T) {
+	// Same shuffled-by-map-iteration scenario the RLE bug came from: a solid
+	// fill arrives out of row-major order.
+	pixels := []Pixel{
+		{X: 2, Y: 1, Color: "#fff"},
+		{X: 0, Y: 0, Color: "#fff"},
+		{X: 1, Y: 0, Color: "#fff"},
+		{X: 0, Y: 1, Color: "#fff"},
+	}
+
+	sortPixelsByPosition(pixels)
+
+	want := []Pixel{
+		{X: 0, Y: 0, Color: "#fff"},
+		{X: 1, Y: 0, Color: "#fff"},
+		{X: 0, Y: 1, Color: "#fff"},
+		{X: 2, Y: 1, Color: "#fff"},
+	}
+	if !reflect.DeepEqual(pixels, want) {
+		t.Errorf("sortPixelsByPosition gave %+v, want %+v", pixels, want)
+	}
+}
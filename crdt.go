@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// ===== LAMPORT CLOCK =====
+//
+// Taubyte functions are ephemeral, so the per-node Lamport clock can't live
+// in a package-level variable - it has to round-trip through the database on
+// every message so it survives cold starts.
+
+// tickLamport advances this node's persisted Lamport clock given the
+// incoming clock value carried by a received message, per the standard
+// Lamport rule: local = max(local, incoming) + 1. It returns the new value,
+// which callers embed in every Pixel/ChatMessage they store so that
+// (lamport, sourceId) can be compared across nodes regardless of the order
+// writes actually land in.
+func tickLamport(incoming int64) (int64, error) {
+	db, err := database.New("/clock")
+	if err != nil {
+		return 0, err
+	}
+
+	var local int64
+	if raw, err := db.Get("/lamport"); err == nil {
+		local, _ = strconv.ParseInt(string(raw), 10, 64)
+	}
+
+	next := incoming
+	if local > next {
+		next = local
+	}
+	next++
+
+	if err := db.Put("/lamport", []byte(strconv.FormatInt(next, 10))); err != nil {
+		return 0, fmt.Errorf("failed to persist Lamport clock: %w", err)
+	}
+	return next, nil
+}
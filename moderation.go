@@ -0,0 +1,356 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+	pubsub "github.com/taubyte/go-sdk/pubsub/node"
+)
+
+// ===== TYPES =====
+
+// RegionLock restricts writes inside [X1,Y1]-[X2,Y2] (inclusive) to
+// OwnerUserID and AllowedUsers, optionally expiring at Expiry (unix millis,
+// 0 = never). Stored at /locks/<room>/<x1>:<y1>-<x2>:<y2>.
+type RegionLock struct {
+	X1           int      `json:"x1"`
+	Y1           int      `json:"y1"`
+	X2           int      `json:"x2"`
+	Y2           int      `json:"y2"`
+	OwnerUserID  string   `json:"ownerUserId"`
+	Expiry       int64    `json:"expiry,omitempty"`
+	AllowedUsers []string `json:"allowedUsers,omitempty"`
+}
+
+// Cooldown is a user's r/place-style write cooldown, stored at
+// /cooldown/<room>/<userId>.
+type Cooldown struct {
+	UserID          string `json:"userId"`
+	NextAllowedNano int64  `json:"nextAllowedNano"`
+}
+
+type cooldownRejection struct {
+	Rejected   bool   `json:"rejected"`
+	Reason     string `json:"reason"`
+	Room       string `json:"room"`
+	UserID     string `json:"userId,omitempty"`
+	RetryAfter int64  `json:"retryAfter,omitempty"` // milliseconds until the user may write again
+}
+
+// ===== CONSTANTS =====
+const (
+	DefaultCooldownMillis = 3000 // r/place-style per-user write cooldown
+)
+
+// ===== UTILITY FUNCTIONS =====
+
+// regionKey canonicalizes a rectangle's corners so lockRegion/unlockRegion
+// and the lookup inside onPixelUpdate always agree on the same key
+// regardless of which corners the caller passed in.
+func regionKey(room string, x1, y1, x2, y2 int) string {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	return fmt.Sprintf("/locks/%s/%d:%d-%d:%d", room, x1, y1, x2, y2)
+}
+
+// roomLocks lists every (non-canonicalization-dependent) region lock stored
+// for room.
+func roomLocks(db *database.Database, room string) []RegionLock {
+	keys, err := db.List(fmt.Sprintf("/locks/%s/", room))
+	if err != nil {
+		return nil
+	}
+
+	locks := make([]RegionLock, 0, len(keys))
+	for _, key := range keys {
+		raw, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var lock RegionLock
+		if json.Unmarshal(raw, &lock) != nil {
+			continue
+		}
+		locks = append(locks, lock)
+	}
+	return locks
+}
+
+// blockingLock returns the lock covering (x, y) that userId isn't permitted
+// to write through, or nil if the write is allowed.
+func blockingLock(locks []RegionLock, x, y int, userId string, now int64) *RegionLock {
+	for i := range locks {
+		lock := locks[i]
+		if x < lock.X1 || x > lock.X2 || y < lock.Y1 || y > lock.Y2 {
+			continue
+		}
+		if lock.Expiry != 0 && now >= lock.Expiry {
+			continue
+		}
+		if userId == lock.OwnerUserID {
+			continue
+		}
+		allowed := false
+		for _, u := range lock.AllowedUsers {
+			if u == userId {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			continue
+		}
+		return &locks[i]
+	}
+	return nil
+}
+
+// checkCooldown reports whether userId may write to room right now, and if
+// not, how many milliseconds remain.
+func checkCooldown(db *database.Database, room, userId string) (allowed bool, retryAfterMs int64) {
+	raw, err := db.Get(fmt.Sprintf("/cooldown/%s/%s", room, userId))
+	if err != nil {
+		return true, 0
+	}
+
+	var cooldown Cooldown
+	if json.Unmarshal(raw, &cooldown) != nil {
+		return true, 0
+	}
+
+	now := time.Now().UnixNano()
+	if now >= cooldown.NextAllowedNano {
+		return true, 0
+	}
+	return false, (cooldown.NextAllowedNano - now) / int64(time.Millisecond)
+}
+
+// armCooldown sets userId's next allowed write time in room to now + DefaultCooldownMillis.
+func armCooldown(db *database.Database, room, userId string) error {
+	cooldown := Cooldown{
+		UserID:          userId,
+		NextAllowedNano: time.Now().UnixNano() + int64(DefaultCooldownMillis)*int64(time.Millisecond),
+	}
+	raw, err := json.Marshal(cooldown)
+	if err != nil {
+		return err
+	}
+	return db.Put(fmt.Sprintf("/cooldown/%s/%s", room, userId), raw)
+}
+
+// broadcastCooldownRejection republishes a cooldown rejection on the pixel
+// channel so only the offending client reacts with cooldown UI.
+func broadcastCooldownRejection(room, userId string, retryAfterMs int64) {
+	payload, err := json.Marshal(cooldownRejection{
+		Rejected:   true,
+		Reason:     "cooldown",
+		Room:       room,
+		UserID:     userId,
+		RetryAfter: retryAfterMs,
+	})
+	if err != nil {
+		fmt.Printf("❌ [broadcastCooldownRejection] Failed to marshal rejection: %v\n", err)
+		return
+	}
+
+	channel, err := pubsub.Channel("pixelupdates")
+	if err != nil {
+		fmt.Printf("❌ [broadcastCooldownRejection] Failed to open pixelupdates channel: %v\n", err)
+		return
+	}
+
+	if err := channel.Publish(payload); err != nil {
+		fmt.Printf("❌ [broadcastCooldownRejection] Failed to publish rejection: %v\n", err)
+	}
+}
+
+func parseAllowedUsers(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	users := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			users = append(users, p)
+		}
+	}
+	return users
+}
+
+func queryInt(h http.Event, name string) (int, error) {
+	raw, err := h.Query().Get(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(raw)
+}
+
+// ===== HTTP HANDLERS =====
+
+//export lockRegion
+func lockRegion(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	x1, err := queryInt(h, "x1")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	y1, err := queryInt(h, "y1")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	x2, err := queryInt(h, "x2")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	y2, err := queryInt(h, "y2")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	ownerUserId, err := h.Query().Get("ownerUserId")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	// Canonicalize corners the same way regionKey does, so a lock stored
+	// from an inverted drag-select (bottom-right to top-left) still has
+	// X1<=X2/Y1<=Y2 - blockingLock's range check can never match otherwise,
+	// silently blocking nothing.
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+
+	var expiry int64
+	if ttlStr, err := h.Query().Get("ttlSeconds"); err == nil {
+		if ttl, err := strconv.ParseInt(ttlStr, 10, 64); err == nil && ttl > 0 {
+			expiry = time.Now().UnixMilli() + ttl*1000
+		}
+	}
+
+	allowedUsers, _ := h.Query().Get("allowedUsers")
+
+	lock := RegionLock{
+		X1: x1, Y1: y1, X2: x2, Y2: y2,
+		OwnerUserID:  ownerUserId,
+		Expiry:       expiry,
+		AllowedUsers: parseAllowedUsers(allowedUsers),
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	key := regionKey(room, x1, y1, x2, y2)
+
+	// An already-locked rectangle can only be re-locked (new expiry/allowed
+	// users, released, etc.) by its existing owner - same rule as
+	// setRateLimitConfig in chunk0-4 - so a lock can't be silently
+	// overwritten out from under the moderator who set it.
+	if existingRaw, err := db.Get(key); err == nil {
+		var existing RegionLock
+		if json.Unmarshal(existingRaw, &existing) == nil && existing.OwnerUserID != "" && existing.OwnerUserID != ownerUserId {
+			return fail(h, fmt.Errorf("region is locked by a different owner"), 403)
+		}
+	}
+
+	raw, err := json.Marshal(lock)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	if err := db.Put(key, raw); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("🔒 [lockRegion] Locked (%d,%d)-(%d,%d) in room %s for owner %s\n", x1, y1, x2, y2, room, ownerUserId)
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(raw)
+	h.Return(200)
+	return 0
+}
+
+//export unlockRegion
+func unlockRegion(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	x1, err := queryInt(h, "x1")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	y1, err := queryInt(h, "y1")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	x2, err := queryInt(h, "x2")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	y2, err := queryInt(h, "y2")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	ownerUserId, err := h.Query().Get("ownerUserId")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	key := regionKey(room, x1, y1, x2, y2)
+
+	// Only the lock's own OwnerUserID may unlock it - without this, anyone
+	// who knows (or brute-forces) the room/coordinates could unlock a
+	// moderator's region, defeating the point of locking it in the first
+	// place.
+	if existingRaw, err := db.Get(key); err == nil {
+		var existing RegionLock
+		if json.Unmarshal(existingRaw, &existing) == nil && existing.OwnerUserID != "" && existing.OwnerUserID != ownerUserId {
+			return fail(h, fmt.Errorf("region is locked by a different owner"), 403)
+		}
+	}
+
+	if err := db.Delete(key); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("🔓 [unlockRegion] Unlocked (%d,%d)-(%d,%d) in room %s\n", x1, y1, x2, y2, room)
+
+	h.Write([]byte(`{"unlocked":true}`))
+	h.Return(200)
+	return 0
+}
@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	pubsub "github.com/taubyte/go-sdk/pubsub/node"
+)
+
+// ===== TYPES =====
+
+// PresenceHeartbeat is the persisted state of one user's presence in a room,
+// stored at /presence/<room>/<userId>. A user is considered online as long
+// as a heartbeat within PresenceWindowSeconds exists and no tombstone has
+// been published for them.
+type PresenceHeartbeat struct {
+	UserID        string `json:"userId"`
+	Username      string `json:"username"`
+	Color         string `json:"color"`
+	LastHeartbeat int64  `json:"lastHeartbeat"` // unix millis
+	Typing        bool   `json:"typing,omitempty"`
+	Offline       bool   `json:"offline,omitempty"` // set by leaveGame's tombstone
+}
+
+// ===== CONSTANTS =====
+const (
+	PresenceWindowSeconds = 30
+)
+
+// ===== UTILITY FUNCTIONS =====
+
+// putHeartbeat writes (or refreshes) a user's presence row for room.
+func putHeartbeat(room string, heartbeat PresenceHeartbeat) error {
+	db, err := database.New("/presence")
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(heartbeat)
+	if err != nil {
+		return err
+	}
+
+	return db.Put(fmt.Sprintf("/%s/%s", room, heartbeat.UserID), raw)
+}
+
+// getHeartbeat loads a user's stored presence row for room, returning the
+// zero value (not an error) if they've never had one - e.g. a typing
+// indicator arriving before their first joinGame/heartbeat.
+func getHeartbeat(room, userId string) (PresenceHeartbeat, error) {
+	db, err := database.New("/presence")
+	if err != nil {
+		return PresenceHeartbeat{}, err
+	}
+
+	raw, err := db.Get(fmt.Sprintf("/%s/%s", room, userId))
+	if err != nil {
+		return PresenceHeartbeat{}, nil
+	}
+
+	var heartbeat PresenceHeartbeat
+	if json.Unmarshal(raw, &heartbeat) != nil {
+		return PresenceHeartbeat{}, nil
+	}
+	return heartbeat, nil
+}
+
+// isOnline reports whether heartbeat is within the presence window and
+// hasn't been tombstoned.
+func isOnline(heartbeat PresenceHeartbeat, now int64) bool {
+	if heartbeat.Offline {
+		return false
+	}
+	return now-heartbeat.LastHeartbeat <= PresenceWindowSeconds*1000
+}
+
+// broadcastPresence republishes a user's presence state so subscribers get
+// an immediate update instead of waiting for their next getUsers poll.
+func broadcastPresence(heartbeat PresenceHeartbeat) {
+	payload, err := json.Marshal(heartbeat)
+	if err != nil {
+		fmt.Printf("❌ [broadcastPresence] Failed to marshal heartbeat: %v\n", err)
+		return
+	}
+
+	channel, err := pubsub.Channel("presence")
+	if err != nil {
+		fmt.Printf("❌ [broadcastPresence] Failed to open presence channel: %v\n", err)
+		return
+	}
+
+	if err := channel.Publish(payload); err != nil {
+		fmt.Printf("❌ [broadcastPresence] Failed to publish heartbeat: %v\n", err)
+	}
+}
+
+// ===== HTTP HANDLERS =====
+
+//export getPresenceChannelURL
+func getPresenceChannelURL(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	channel, err := pubsub.Channel("presence")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+	channel.Subscribe()
+
+	url, err := channel.WebSocket().Url()
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "text/plain")
+	h.Write([]byte(url.Path))
+	h.Return(200)
+	return 0
+}
+
+//export joinGame
+func joinGame(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	userId, err := h.Query().Get("userId")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	username, err := h.Query().Get("username")
+	if err != nil {
+		username = userId
+	}
+	color, err := h.Query().Get("color")
+	if err != nil {
+		color = "#000000"
+	}
+
+	heartbeat := PresenceHeartbeat{
+		UserID:        userId,
+		Username:      username,
+		Color:         color,
+		LastHeartbeat: time.Now().UnixMilli(),
+	}
+
+	if err := putHeartbeat(room, heartbeat); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("👋 [joinGame] %s (%s) joined room %s\n", username, userId, room)
+	broadcastPresence(heartbeat)
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write([]byte(`{"joined":true}`))
+	h.Return(200)
+	return 0
+}
+
+//export leaveGame
+func leaveGame(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	userId, err := h.Query().Get("userId")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	// Tombstone: marks the user offline immediately across all subscribers,
+	// instead of waiting for their heartbeat to age out of the window.
+	heartbeat := PresenceHeartbeat{
+		UserID:        userId,
+		LastHeartbeat: time.Now().UnixMilli(),
+		Offline:       true,
+	}
+
+	if err := putHeartbeat(room, heartbeat); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("👋 [leaveGame] %s left room %s\n", userId, room)
+	broadcastPresence(heartbeat)
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write([]byte(`{"left":true}`))
+	h.Return(200)
+	return 0
+}
+
+//export getUsers
+func getUsers(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	db, err := database.New("/presence")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	roomPrefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(roomPrefix)
+	if err != nil {
+		jsonData, _ := json.Marshal([]User{})
+		h.Headers().Set("Content-Type", "application/json")
+		h.Write(jsonData)
+		h.Return(200)
+		return 0
+	}
+
+	now := time.Now().UnixMilli()
+	users := []User{}
+	for _, key := range keys {
+		raw, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var heartbeat PresenceHeartbeat
+		if json.Unmarshal(raw, &heartbeat) != nil {
+			continue
+		}
+
+		// Sweep stale/tombstoned rows on read instead of just flagging them
+		// offline, so a long-lived room's presence keys don't accumulate
+		// forever.
+		if !isOnline(heartbeat, now) {
+			if err := db.Delete(key); err != nil {
+				fmt.Printf("❌ [getUsers] Failed to sweep stale presence row %s: %v\n", key, err)
+			}
+			continue
+		}
+
+		users = append(users, User{
+			ID:       heartbeat.UserID,
+			Username: heartbeat.Username,
+			Color:    heartbeat.Color,
+			Online:   true,
+		})
+	}
+
+	jsonData, err := json.Marshal(users)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(jsonData)
+	h.Return(200)
+	return 0
+}
+
+// ===== PUB/SUB HANDLERS =====
+
+//export onUserUpdate
+func onUserUpdate(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+
+	var heartbeat struct {
+		PresenceHeartbeat
+		Room string `json:"room"`
+	}
+
+	if err := json.Unmarshal(data, &heartbeat); err != nil {
+		return 1
+	}
+
+	room := heartbeat.Room
+	if room == "" {
+		room = "default"
+	}
+
+	heartbeat.LastHeartbeat = time.Now().UnixMilli()
+
+	if err := putHeartbeat(room, heartbeat.PresenceHeartbeat); err != nil {
+		fmt.Printf("❌ [onUserUpdate] Failed to store heartbeat for %s: %v\n", heartbeat.UserID, err)
+		return 1
+	}
+
+	fmt.Printf("💓 [onUserUpdate] Heartbeat from %s in room %s\n", heartbeat.UserID, room)
+	return 0
+}
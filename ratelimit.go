@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	pubsub "github.com/taubyte/go-sdk/pubsub/node"
+)
+
+// ===== TYPES =====
+
+// RateLimitConfig is the admin-configurable per-room abuse guardrails,
+// stored at /config/<room> in the /canvas database.
+type RateLimitConfig struct {
+	Room              string `json:"room"`
+	PixelsPerSecond   int    `json:"pixelsPerSecond"`
+	MessagesPerMinute int    `json:"messagesPerMinute"`
+	OwnerUserID       string `json:"ownerUserId,omitempty"`
+}
+
+// tokenBucket is the persisted state of a single token bucket, stored at
+// /ratelimit/<kind>/<room>/<key> so it survives Taubyte function cold starts.
+type tokenBucket struct {
+	Tokens         float64 `json:"tokens"`
+	LastRefillNano int64   `json:"lastRefillNano"`
+}
+
+// rateLimitRejection is broadcast back on the originating pubsub channel so
+// only the offending client reacts (shows cooldown UI) instead of everyone.
+type rateLimitRejection struct {
+	Rejected bool   `json:"rejected"`
+	Reason   string `json:"reason"`
+	Room     string `json:"room"`
+	UserID   string `json:"userId,omitempty"`
+}
+
+// ===== CONSTANTS =====
+const (
+	DefaultPixelsPerSecond   = 20
+	DefaultMessagesPerMinute = 20
+
+	// pixelBurstSeconds lets a pixel bucket hold this many seconds' worth of
+	// its steady-state rate, so a single drag-paint stroke or one of the
+	// RLE/bucket-fill batches chunk0-2 added can still drain through after a
+	// bit of idle time - with burst == rate, any batch bigger than the
+	// per-second allowance was rejected forever, no matter how long the
+	// client waited.
+	pixelBurstSeconds = 10
+)
+
+// ===== CONFIG =====
+
+// roomRateLimitConfig loads room's config from /config/<room>, falling back
+// to the package defaults if the room has never been configured.
+func roomRateLimitConfig(db *database.Database, room string) RateLimitConfig {
+	cfg := RateLimitConfig{
+		Room:              room,
+		PixelsPerSecond:   DefaultPixelsPerSecond,
+		MessagesPerMinute: DefaultMessagesPerMinute,
+	}
+
+	raw, err := db.Get(fmt.Sprintf("/config/%s", room))
+	if err != nil {
+		return cfg
+	}
+	if json.Unmarshal(raw, &cfg) != nil {
+		fmt.Printf("❌ [roomRateLimitConfig] Failed to parse config for room %s, using defaults\n", room)
+		return RateLimitConfig{Room: room, PixelsPerSecond: DefaultPixelsPerSecond, MessagesPerMinute: DefaultMessagesPerMinute}
+	}
+	return cfg
+}
+
+// ===== TOKEN BUCKET =====
+
+// tokenBucketRefill advances bucket to now, adding elapsed*rate tokens
+// capped at burst (or initializing a never-seen bucket to a full burst).
+// Kept separate from takeTokens' db I/O so the refill math is plain,
+// dependency-free arithmetic a unit test can drive directly.
+func tokenBucketRefill(bucket tokenBucket, rate, burst float64, now int64) tokenBucket {
+	if bucket.LastRefillNano == 0 {
+		return tokenBucket{Tokens: burst, LastRefillNano: now}
+	}
+
+	elapsedSeconds := float64(now-bucket.LastRefillNano) / float64(time.Second)
+	if elapsedSeconds > 0 {
+		bucket.Tokens += elapsedSeconds * rate
+		if bucket.Tokens > burst {
+			bucket.Tokens = burst
+		}
+		bucket.LastRefillNano = now
+	}
+	return bucket
+}
+
+// tokenBucketSpend reports whether bucket holds at least cost tokens and, if
+// so, returns bucket with them deducted.
+func tokenBucketSpend(bucket tokenBucket, cost float64) (tokenBucket, bool) {
+	if bucket.Tokens < cost {
+		return bucket, false
+	}
+	bucket.Tokens -= cost
+	return bucket, true
+}
+
+// takeTokens applies the token-bucket algorithm against the bucket stored at
+// key: refill at `rate` tokens/sec up to `burst` capacity, then try to spend
+// `cost` tokens. Returns whether the request is allowed; the bucket's new
+// state is persisted either way so repeated rejections don't grant free tokens.
+func takeTokens(db *database.Database, key string, rate, burst, cost float64) (bool, error) {
+	var bucket tokenBucket
+	if raw, err := db.Get(key); err == nil {
+		if json.Unmarshal(raw, &bucket) != nil {
+			bucket = tokenBucket{}
+		}
+	}
+
+	bucket = tokenBucketRefill(bucket, rate, burst, time.Now().UnixNano())
+
+	bucket, allowed := tokenBucketSpend(bucket, cost)
+
+	raw, err := json.Marshal(bucket)
+	if err != nil {
+		return allowed, err
+	}
+	return allowed, db.Put(key, raw)
+}
+
+// checkPixelRateLimit enforces cfg.PixelsPerSecond pixels/second per
+// (room, userId). There's no per-source-IP layer: onPixelUpdate is only
+// reachable over the pubsub channel, which doesn't expose the caller's
+// X-Forwarded-For the way an http.Event would (see fix commit 27e1e7a), so
+// userId is the only identity available to key off of.
+func checkPixelRateLimit(db *database.Database, cfg RateLimitConfig, room, userId string, pixelCount int) (bool, error) {
+	userKey := fmt.Sprintf("/ratelimit/pixel/%s/%s", room, userId)
+	rate := float64(cfg.PixelsPerSecond)
+	burst := rate * pixelBurstSeconds
+	return takeTokens(db, userKey, rate, burst, float64(pixelCount))
+}
+
+// checkChatRateLimit enforces cfg.MessagesPerMinute messages/minute per
+// (room, userId), for the same reason checkPixelRateLimit has no IP layer.
+func checkChatRateLimit(db *database.Database, cfg RateLimitConfig, room, userId string) (bool, error) {
+	userKey := fmt.Sprintf("/ratelimit/chat/%s/%s", room, userId)
+	rate := float64(cfg.MessagesPerMinute) / 60.0
+	return takeTokens(db, userKey, rate, float64(cfg.MessagesPerMinute), 1)
+}
+
+// broadcastRejection republishes a rejection envelope on channelName so the
+// originating client - and only that client - can react with cooldown UI.
+func broadcastRejection(channelName, reason, room, userId string) {
+	payload, err := json.Marshal(rateLimitRejection{Rejected: true, Reason: reason, Room: room, UserID: userId})
+	if err != nil {
+		fmt.Printf("❌ [broadcastRejection] Failed to marshal rejection: %v\n", err)
+		return
+	}
+
+	channel, err := pubsub.Channel(channelName)
+	if err != nil {
+		fmt.Printf("❌ [broadcastRejection] Failed to open channel %s: %v\n", channelName, err)
+		return
+	}
+
+	if err := channel.Publish(payload); err != nil {
+		fmt.Printf("❌ [broadcastRejection] Failed to publish rejection on %s: %v\n", channelName, err)
+	}
+}
+
+// ===== HTTP HANDLERS =====
+
+//export getRateLimitConfig
+func getRateLimitConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	cfg := roomRateLimitConfig(db, room)
+
+	jsonData, err := json.Marshal(cfg)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(jsonData)
+	h.Return(200)
+	return 0
+}
+
+//export setRateLimitConfig
+func setRateLimitConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	body, err := h.Body()
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	var cfg RateLimitConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return fail(h, err, 400)
+	}
+	if cfg.Room == "" {
+		return fail(h, fmt.Errorf("room is required"), 400)
+	}
+	if cfg.OwnerUserID == "" {
+		return fail(h, fmt.Errorf("ownerUserId is required"), 400)
+	}
+	if cfg.PixelsPerSecond <= 0 {
+		cfg.PixelsPerSecond = DefaultPixelsPerSecond
+	}
+	if cfg.MessagesPerMinute <= 0 {
+		cfg.MessagesPerMinute = DefaultMessagesPerMinute
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	// First write to a room's config claims ownership for that ownerUserId,
+	// same as RegionLock's OwnerUserID; every write after that must come
+	// from the same owner, so the protection these limits add can't be
+	// erased by any other caller simply POSTing a new config over it.
+	configKey := fmt.Sprintf("/config/%s", cfg.Room)
+	if existingRaw, err := db.Get(configKey); err == nil {
+		var existing RateLimitConfig
+		if json.Unmarshal(existingRaw, &existing) == nil && existing.OwnerUserID != "" && existing.OwnerUserID != cfg.OwnerUserID {
+			return fail(h, fmt.Errorf("room %s is owned by a different user", cfg.Room), 403)
+		}
+	}
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	if err := db.Put(configKey, raw); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("⚙️ [setRateLimitConfig] Updated config for room %s: %+v\n", cfg.Room, cfg)
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(raw)
+	h.Return(200)
+	return 0
+}
@@ -0,0 +1,62 @@
+package lib
+
+import "testing"
+
+func TestTokenBucketRefillInitializesToFullBurst(t *testing.T) {
+	bucket := tokenBucketRefill(tokenBucket{}, 20, 200, 1_000_000_000)
+	if bucket.Tokens != 200 {
+		t.Errorf("Tokens = %v, want a full burst of 200", bucket.Tokens)
+	}
+	if bucket.LastRefillNano != 1_000_000_000 {
+		t.Errorf("LastRefillNano = %v, want 1_000_000_000", bucket.LastRefillNano)
+	}
+}
+
+func TestTokenBucketRefillCapsAtBurst(t *testing.T) {
+	bucket := tokenBucket{Tokens: 195, LastRefillNano: 0 + 1} // already initialized
+	// 100 seconds at 20/sec would add 2000 tokens - burst must cap it.
+	refilled := tokenBucketRefill(bucket, 20, 200, bucket.LastRefillNano+100*int64(1e9))
+	if refilled.Tokens != 200 {
+		t.Errorf("Tokens = %v, want capped at burst 200", refilled.Tokens)
+	}
+}
+
+func TestTokenBucketRefillAddsElapsedRate(t *testing.T) {
+	bucket := tokenBucket{Tokens: 0, LastRefillNano: 1}
+	// 2 seconds at 20/sec should add 40 tokens.
+	refilled := tokenBucketRefill(bucket, 20, 200, bucket.LastRefillNano+2*int64(1e9))
+	if refilled.Tokens != 40 {
+		t.Errorf("Tokens = %v, want 40", refilled.Tokens)
+	}
+}
+
+func TestTokenBucketSpendRejectsInsufficientTokens(t *testing.T) {
+	bucket := tokenBucket{Tokens: 5}
+	_, allowed := tokenBucketSpend(bucket, 10)
+	if allowed {
+		t.Error("spend of 10 against a 5-token bucket should be rejected")
+	}
+}
+
+func TestTokenBucketSpendDeductsOnSuccess(t *testing.T) {
+	bucket := tokenBucket{Tokens: 50}
+	spent, allowed := tokenBucketSpend(bucket, 30)
+	if !allowed {
+		t.Fatal("spend of 30 against a 50-token bucket should be allowed")
+	}
+	if spent.Tokens != 20 {
+		t.Errorf("Tokens after spend = %v, want 20", spent.Tokens)
+	}
+}
+
+func TestTokenBucketSpendDoesNotRejectForeverOnLargeBatch(t *testing.T) {
+	// Regression test for the burst==rate bug (fix commit 885b13e): a batch
+	// bigger than the steady-state rate must eventually drain through once
+	// enough idle time has refilled the bucket to the (now larger) burst.
+	rate, burst := 20.0, 20.0*pixelBurstSeconds
+	bucket := tokenBucketRefill(tokenBucket{}, rate, burst, 1)
+	idled := tokenBucketRefill(bucket, rate, burst, 1+100*int64(1e9))
+	if _, allowed := tokenBucketSpend(idled, 50); !allowed {
+		t.Error("a 50-token batch should be allowed after idling long enough to refill past it")
+	}
+}
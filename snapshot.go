@@ -0,0 +1,323 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+// ===== TYPES =====
+
+// CanvasSnapshot is a compacted, gzip-compressed view of every pixel in a
+// room at the moment it was taken, so getCanvasAt doesn't have to replay the
+// full per-pixel CRDT history on every read. getCanvas does not read
+// snapshots; it always replays the full history.
+type CanvasSnapshot struct {
+	Room      string     `json:"room"`
+	Timestamp int64      `json:"timestamp"`
+	Pixels    [][]string `json:"pixels"` // [y][x] -> color, same layout as getCanvas
+}
+
+// PixelHistoryEntry is one write in a single cell's audit trail, returned by
+// getPixelHistory in write order.
+type PixelHistoryEntry struct {
+	Color     string `json:"color"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp"`
+	SourceId  string `json:"sourceId"`
+}
+
+// ===== UTILITY FUNCTIONS =====
+
+func compressSnapshot(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressSnapshot(compressed []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+// nearestSnapshot finds the most recent snapshot for room with
+// Timestamp <= t, returning its key and timestamp ("", 0 if none exists).
+func nearestSnapshot(db *database.Database, room string, t int64) (string, int64) {
+	roomPrefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(roomPrefix)
+	if err != nil {
+		fmt.Printf("❌ [nearestSnapshot] Error listing snapshots: %v\n", err)
+		return "", 0
+	}
+
+	var bestKey string
+	var bestTs int64 = -1
+	for _, key := range keys {
+		if len(key) <= len(roomPrefix) {
+			continue
+		}
+		ts, err := strconv.ParseInt(key[len(roomPrefix):], 10, 64)
+		if err != nil || ts > t {
+			continue
+		}
+		if ts > bestTs {
+			bestTs = ts
+			bestKey = key
+		}
+	}
+
+	if bestKey == "" {
+		return "", 0
+	}
+	return bestKey, bestTs
+}
+
+// canvasAt reconstructs the canvas for room as of time t by loading the
+// nearest snapshot at or before t and replaying pixel writes newer than the
+// snapshot (and no newer than t) on top of it.
+func canvasAt(room string, t int64) ([][]string, error) {
+	snapDb, err := database.New("/canvas-snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	canvas := blankCanvas()
+	var baseTs int64
+
+	if key, ts := nearestSnapshot(snapDb, room, t); key != "" {
+		compressed, err := snapDb.Get(key)
+		if err == nil {
+			if raw, err := decompressSnapshot(compressed); err == nil {
+				var snapshot CanvasSnapshot
+				if json.Unmarshal(raw, &snapshot) == nil {
+					canvas = snapshot.Pixels
+					baseTs = ts
+				}
+			}
+		}
+	}
+
+	overlay, err := reconstructCanvas(room, baseTs, t)
+	if err != nil {
+		return nil, err
+	}
+	for cell, color := range overlay {
+		canvas[cell[1]][cell[0]] = color
+	}
+
+	return canvas, nil
+}
+
+// ===== HTTP HANDLERS =====
+
+//export snapshotCanvas
+func snapshotCanvas(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		room = "default"
+	}
+
+	colors, err := reconstructCanvas(room, -1, math.MaxInt64)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+	canvas := blankCanvas()
+	for cell, color := range colors {
+		canvas[cell[1]][cell[0]] = color
+	}
+
+	snapshot := CanvasSnapshot{
+		Room:      room,
+		Timestamp: time.Now().UnixNano(),
+		Pixels:    canvas,
+	}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	compressed, err := compressSnapshot(raw)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	db, err := database.New("/canvas-snapshots")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	snapshotKey := fmt.Sprintf("/%s/%d", room, snapshot.Timestamp)
+	if err := db.Put(snapshotKey, compressed); err != nil {
+		return fail(h, err, 500)
+	}
+
+	fmt.Printf("📸 [snapshotCanvas] Stored snapshot for room %s at %d (%d bytes compressed, %d bytes raw)\n",
+		room, snapshot.Timestamp, len(compressed), len(raw))
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write([]byte(fmt.Sprintf(`{"room":%q,"timestamp":%d}`, room, snapshot.Timestamp)))
+	h.Return(200)
+	return 0
+}
+
+//export getCanvasAt
+func getCanvasAt(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	tStr, err := h.Query().Get("t")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	t, err := strconv.ParseInt(tStr, 10, 64)
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	fmt.Printf("🕰️ [getCanvasAt] Reconstructing room %s as of t=%d\n", room, t)
+	canvas, err := canvasAt(room, t)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	jsonData, err := json.Marshal(canvas)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(jsonData)
+	h.Return(200)
+	return 0
+}
+
+//export getPixelHistory
+func getPixelHistory(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+
+	room, err := h.Query().Get("room")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	xStr, err := h.Query().Get("x")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+	yStr, err := h.Query().Get("y")
+	if err != nil {
+		return fail(h, err, 400)
+	}
+
+	db, err := database.New("/canvas")
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	cellPrefix := fmt.Sprintf("/%s/%s:%s/", room, xStr, yStr)
+	fmt.Printf("🔍 [getPixelHistory] Listing keys with prefix: %s\n", cellPrefix)
+	keys, err := db.List(cellPrefix)
+	if err != nil {
+		fmt.Printf("❌ [getPixelHistory] Error listing keys: %v\n", err)
+		jsonData, _ := json.Marshal([]PixelHistoryEntry{})
+		h.Headers().Set("Content-Type", "application/json")
+		h.Write(jsonData)
+		h.Return(200)
+		return 0
+	}
+
+	var history []PixelHistoryEntry
+	for _, key := range keys {
+		if len(key) <= len(cellPrefix) {
+			continue
+		}
+		version := key[len(cellPrefix):]
+		dash := -1
+		for i := 0; i < len(version); i++ {
+			if version[i] == '-' {
+				dash = i
+				break
+			}
+		}
+		if dash < 0 {
+			continue
+		}
+		ts, err := strconv.ParseInt(version[:dash], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		pixelData, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var pixel Pixel
+		if json.Unmarshal(pixelData, &pixel) != nil {
+			continue
+		}
+
+		history = append(history, PixelHistoryEntry{
+			Color:     pixel.Color,
+			UserID:    pixel.UserID,
+			Username:  pixel.Username,
+			Timestamp: ts,
+			SourceId:  version[dash+1:],
+		})
+	}
+
+	// Sort by ingest timestamp, oldest first
+	for i := 0; i < len(history); i++ {
+		for j := i + 1; j < len(history); j++ {
+			if history[i].Timestamp > history[j].Timestamp {
+				history[i], history[j] = history[j], history[i]
+			}
+		}
+	}
+
+	jsonData, err := json.Marshal(history)
+	if err != nil {
+		return fail(h, err, 500)
+	}
+
+	h.Headers().Set("Content-Type", "application/json")
+	h.Write(jsonData)
+	h.Return(200)
+	return 0
+}